@@ -0,0 +1,166 @@
+package awsiam
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+type IAM interface {
+	CreateUser(userName string) (string, error)
+	DeleteUser(userName string) error
+	PutUserPolicy(userName, policyName, policyDocument string) error
+	DeleteUserPolicy(userName, policyName string) error
+	CreateAccessKey(userName string) (string, string, error)
+	DeleteAccessKeys(userName string) error
+}
+
+type IAMUser struct {
+	iamsvc *iam.IAM
+	logger lager.Logger
+}
+
+func NewIAMUser(
+	iamsvc *iam.IAM,
+	logger lager.Logger,
+) *IAMUser {
+	return &IAMUser{
+		iamsvc: iamsvc,
+		logger: logger.Session("iam-user"),
+	}
+}
+
+func (u *IAMUser) CreateUser(userName string) (string, error) {
+	createUserInput := &iam.CreateUserInput{
+		UserName: aws.String(userName),
+	}
+	u.logger.Debug("create-user", lager.Data{"input": createUserInput})
+
+	createUserOutput, err := u.iamsvc.CreateUser(createUserInput)
+	if err != nil {
+		u.logger.Error("aws-iam-error", err)
+		return "", wrapAWSError(err)
+	}
+	u.logger.Debug("create-user", lager.Data{"output": createUserOutput})
+
+	return aws.StringValue(createUserOutput.User.Arn), nil
+}
+
+func (u *IAMUser) DeleteUser(userName string) error {
+	deleteUserInput := &iam.DeleteUserInput{
+		UserName: aws.String(userName),
+	}
+	u.logger.Debug("delete-user", lager.Data{"input": deleteUserInput})
+
+	if _, err := u.iamsvc.DeleteUser(deleteUserInput); err != nil {
+		if isAWSErrCode(err, iam.ErrCodeNoSuchEntityException) {
+			return nil
+		}
+		u.logger.Error("aws-iam-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (u *IAMUser) PutUserPolicy(userName, policyName, policyDocument string) error {
+	putUserPolicyInput := &iam.PutUserPolicyInput{
+		UserName:       aws.String(userName),
+		PolicyName:     aws.String(policyName),
+		PolicyDocument: aws.String(policyDocument),
+	}
+	u.logger.Debug("put-user-policy", lager.Data{"input": putUserPolicyInput})
+
+	if _, err := u.iamsvc.PutUserPolicy(putUserPolicyInput); err != nil {
+		u.logger.Error("aws-iam-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (u *IAMUser) DeleteUserPolicy(userName, policyName string) error {
+	deleteUserPolicyInput := &iam.DeleteUserPolicyInput{
+		UserName:   aws.String(userName),
+		PolicyName: aws.String(policyName),
+	}
+	u.logger.Debug("delete-user-policy", lager.Data{"input": deleteUserPolicyInput})
+
+	if _, err := u.iamsvc.DeleteUserPolicy(deleteUserPolicyInput); err != nil {
+		if isAWSErrCode(err, iam.ErrCodeNoSuchEntityException) {
+			return nil
+		}
+		u.logger.Error("aws-iam-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (u *IAMUser) CreateAccessKey(userName string) (string, string, error) {
+	createAccessKeyInput := &iam.CreateAccessKeyInput{
+		UserName: aws.String(userName),
+	}
+	u.logger.Debug("create-access-key", lager.Data{"input": createAccessKeyInput})
+
+	createAccessKeyOutput, err := u.iamsvc.CreateAccessKey(createAccessKeyInput)
+	if err != nil {
+		u.logger.Error("aws-iam-error", err)
+		return "", "", wrapAWSError(err)
+	}
+
+	return aws.StringValue(createAccessKeyOutput.AccessKey.AccessKeyId),
+		aws.StringValue(createAccessKeyOutput.AccessKey.SecretAccessKey),
+		nil
+}
+
+func (u *IAMUser) DeleteAccessKeys(userName string) error {
+	listAccessKeysInput := &iam.ListAccessKeysInput{
+		UserName: aws.String(userName),
+	}
+	u.logger.Debug("list-access-keys", lager.Data{"input": listAccessKeysInput})
+
+	listAccessKeysOutput, err := u.iamsvc.ListAccessKeys(listAccessKeysInput)
+	if err != nil {
+		u.logger.Error("aws-iam-error", err)
+		return wrapAWSError(err)
+	}
+
+	for _, accessKey := range listAccessKeysOutput.AccessKeyMetadata {
+		deleteAccessKeyInput := &iam.DeleteAccessKeyInput{
+			UserName:    aws.String(userName),
+			AccessKeyId: accessKey.AccessKeyId,
+		}
+		u.logger.Debug("delete-access-key", lager.Data{"input": deleteAccessKeyInput})
+
+		if _, err := u.iamsvc.DeleteAccessKey(deleteAccessKeyInput); err != nil {
+			u.logger.Error("aws-iam-error", err)
+			return wrapAWSError(err)
+		}
+	}
+
+	return nil
+}
+
+func wrapAWSError(err error) error {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return errors.New(awsErr.Code() + ": " + awsErr.Message())
+	}
+	return err
+}
+
+func isAWSErrCode(err error, codes ...string) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if awsErr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
@@ -1,23 +1,127 @@
 package awss3
 
 import (
+	"context"
 	"errors"
+	"fmt"
 )
 
 type Bucket interface {
-	Describe(bucketName string) (BucketDetails, error)
-	Create(bucketName string, details BucketDetails) (string, error)
-	Modify(bucketName string, details BucketDetails) error
-	Delete(bucketName string) error
+	Describe(ctx context.Context, bucketName, partition string) (BucketDetails, error)
+	Create(ctx context.Context, bucketName string, details BucketDetails) (string, error)
+	Modify(ctx context.Context, bucketName string, details BucketDetails) error
+	Delete(ctx context.Context, bucketName string, details BucketDetails) error
+	DeletePrefix(ctx context.Context, bucketName, prefix string, purgeVersions bool, mfa string) error
 }
 
+// DeletePolicy controls how much data Delete is allowed to remove on its
+// way to deleting the bucket itself.
+type DeletePolicy string
+
+const (
+	// DeletePolicyRetain refuses to delete a bucket that still has
+	// objects or versions in it.
+	DeletePolicyRetain DeletePolicy = "retain"
+	// DeletePolicyEmptyOnly removes current-version objects but leaves
+	// noncurrent versions and delete markers in place.
+	DeletePolicyEmptyOnly DeletePolicy = "empty-only"
+	// DeletePolicyPurge removes every object, version, and delete
+	// marker before deleting the bucket.
+	DeletePolicyPurge DeletePolicy = "purge"
+)
+
 type BucketDetails struct {
 	BucketName string
 	ARN        string
 	Region     string
 	Tags       map[string]string
+
+	Policy string
+	ACL    string
+
+	DeletePolicy DeletePolicy
+	Force        bool
+	MFA          string
+
+	// SharedBucket, when set, means this instance does not own a
+	// dedicated bucket: its data lives under KeyPrefix inside a
+	// pre-created bucket named SharedBucket.
+	SharedBucket string
+	KeyPrefix    string
+
+	CORSRules            []CORSRule
+	Versioning           bool
+	ServerSideEncryption *ServerSideEncryption
+	Logging              *LoggingConfig
+	Lifecycle            []LifecycleRule
+
+	ObjectOwnership string
+	// DisableSecureDefaults opts this instance out of the hardening
+	// S3Bucket.Create otherwise applies to every bucket.
+	DisableSecureDefaults bool
+	// SecureDefaultsDrift is populated by Describe to report whether
+	// that hardening is still in place.
+	SecureDefaultsDrift *SecureDefaultsDrift
+}
+
+// SecureDefaultsDrift reports whether the hardening S3Bucket.Create
+// applies on provisioning is still in place, as observed by Describe.
+type SecureDefaultsDrift struct {
+	PublicAccessBlockMissing   bool
+	SecureTransportDenyMissing bool
+	EncryptionMissing          bool
+	OwnershipControlsDrifted   bool
+}
+
+type CORSRule struct {
+	AllowedHeaders []string
+	AllowedMethods []string
+	AllowedOrigins []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int64
+}
+
+// ServerSideEncryption describes the default encryption applied to new
+// objects. SSEAlgorithm is either "AES256" for SSE-S3 or "aws:kms" for
+// SSE-KMS, in which case KMSMasterKeyID selects the CMK to use.
+type ServerSideEncryption struct {
+	SSEAlgorithm   string
+	KMSMasterKeyID string
+}
+
+type LoggingConfig struct {
+	TargetBucket string
+	TargetPrefix string
+}
+
+type LifecycleRule struct {
+	ID                                 string
+	Prefix                             string
+	Enabled                            bool
+	ExpirationDays                     int64
+	NoncurrentVersionExpirationDays    int64
+	AbortIncompleteMultipartUploadDays int64
 }
 
 var (
 	ErrBucketDoesNotExist = errors.New("s3 bucket does not exist")
+	ErrBucketNotEmpty     = errors.New("s3 bucket is not empty")
 )
+
+// DeleteObjectError is one key's failure within a DeleteObjects call.
+type DeleteObjectError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// DeleteObjectsError aggregates the per-key failures collected while
+// purging a bucket's objects or versions.
+type DeleteObjectsError struct {
+	Errors []DeleteObjectError
+}
+
+func (e *DeleteObjectsError) Error() string {
+	return fmt.Sprintf("failed to delete %d object(s), e.g. %s: %s: %s",
+		len(e.Errors), e.Errors[0].Key, e.Errors[0].Code, e.Errors[0].Message)
+}
@@ -0,0 +1,184 @@
+package awss3
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsEmptyReportsNotEmptyForNoncurrentVersionsOnly(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if _, ok := r.URL.Query()["versions"]; ok {
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult>
+				<Version><Key>old.txt</Key><VersionId>v1</VersionId></Version>
+			</ListVersionsResult>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult></ListBucketResult>`))
+	})
+	defer close()
+
+	empty, err := bucket.isEmpty("my-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty {
+		t.Fatal("expected a bucket with only a noncurrent version to report not empty")
+	}
+}
+
+func TestIsEmptyReportsEmptyWithNoObjectsOrVersions(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if _, ok := r.URL.Query()["versions"]; ok {
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult></ListVersionsResult>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult></ListBucketResult>`))
+	})
+	defer close()
+
+	empty, err := bucket.isEmpty("my-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !empty {
+		t.Fatal("expected a bucket with no objects or versions to report empty")
+	}
+}
+
+func TestClearVersionsPaginatesUsingNextVersionIdMarker(t *testing.T) {
+	var listCalls int32
+	var sawSecondPageMarkers int32
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if _, ok := q["versions"]; ok {
+			n := atomic.AddInt32(&listCalls, 1)
+			w.Header().Set("Content-Type", "application/xml")
+			if n == 1 {
+				w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult>
+					<Version><Key>a.txt</Key><VersionId>v1</VersionId></Version>
+					<IsTruncated>true</IsTruncated>
+					<NextKeyMarker>a.txt</NextKeyMarker>
+					<NextVersionIdMarker>v1</NextVersionIdMarker>
+				</ListVersionsResult>`))
+				return
+			}
+			if q.Get("key-marker") == "a.txt" && q.Get("version-id-marker") == "v1" {
+				atomic.AddInt32(&sawSecondPageMarkers, 1)
+			}
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult>
+				<Version><Key>b.txt</Key><VersionId>v2</VersionId></Version>
+			</ListVersionsResult>`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`))
+	})
+	defer close()
+
+	if err := bucket.clearVersions(context.Background(), "my-bucket", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&listCalls); got != 2 {
+		t.Fatalf("expected clearVersions to follow IsTruncated across exactly 2 pages, got %d", got)
+	}
+	if atomic.LoadInt32(&sawSecondPageMarkers) != 1 {
+		t.Fatal("expected the second page's request to carry the first page's NextKeyMarker and NextVersionIdMarker")
+	}
+}
+
+func TestDeletePurgePolicyClearsVersionsBeforeObjects(t *testing.T) {
+	var sawVersionsCall, sawObjectsCallAfterVersions int32
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/xml")
+		switch {
+		case r.Method == http.MethodGet && hasQueryKey(q, "versions"):
+			atomic.AddInt32(&sawVersionsCall, 1)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult></ListVersionsResult>`))
+		case r.Method == http.MethodGet && q.Get("list-type") == "2":
+			if atomic.LoadInt32(&sawVersionsCall) > 0 {
+				atomic.AddInt32(&sawObjectsCallAfterVersions, 1)
+			}
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult></ListBucketResult>`))
+		case r.Method == http.MethodPost && hasQueryKey(q, "delete"):
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer close()
+
+	bucketDetails := BucketDetails{
+		Force:        true,
+		DeletePolicy: DeletePolicyPurge,
+	}
+	if err := bucket.Delete(context.Background(), "my-bucket", bucketDetails); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&sawVersionsCall) == 0 {
+		t.Fatal("expected DeletePolicyPurge to clear versions")
+	}
+	if atomic.LoadInt32(&sawObjectsCallAfterVersions) == 0 {
+		t.Fatal("expected DeletePolicyPurge to clear current objects after versions, via fallthrough to DeletePolicyEmptyOnly")
+	}
+}
+
+func TestDeleteMFAPropagatedToDeleteObjects(t *testing.T) {
+	var gotMFA string
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/xml")
+		switch {
+		case r.Method == http.MethodGet && hasQueryKey(q, "versions"):
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult>
+				<Version><Key>a.txt</Key><VersionId>v1</VersionId></Version>
+			</ListVersionsResult>`))
+		case r.Method == http.MethodGet && q.Get("list-type") == "2":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult></ListBucketResult>`))
+		case r.Method == http.MethodPost && hasQueryKey(q, "delete"):
+			if mfa := r.Header.Get("x-amz-mfa"); mfa != "" {
+				gotMFA = mfa
+			}
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`))
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer close()
+
+	bucketDetails := BucketDetails{
+		Force:        true,
+		DeletePolicy: DeletePolicyPurge,
+		MFA:          "arn:aws:iam::111111111111:mfa/root-account-mfa-device 123456",
+	}
+	if err := bucket.Delete(context.Background(), "my-bucket", bucketDetails); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotMFA != bucketDetails.MFA {
+		t.Fatalf("expected the MFA code to reach DeleteObjects, got %q", gotMFA)
+	}
+}
+
+func TestDeleteRetainPolicyRefusesNonEmptyBucket(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult>
+			<Contents><Key>still-here.txt</Key></Contents>
+		</ListBucketResult>`))
+	})
+	defer close()
+
+	err := bucket.Delete(context.Background(), "my-bucket", BucketDetails{DeletePolicy: DeletePolicyRetain})
+	if err != ErrBucketNotEmpty {
+		t.Fatalf("expected ErrBucketNotEmpty, got %v", err)
+	}
+}
+
+func hasQueryKey(q map[string][]string, key string) bool {
+	_, ok := q[key]
+	return ok
+}
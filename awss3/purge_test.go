@@ -0,0 +1,141 @@
+package awss3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newTestS3Bucket wires an S3Bucket up to an httptest server standing in
+// for S3, so purge's own control flow can be exercised without a real AWS
+// account.
+func newTestS3Bucket(handler http.HandlerFunc) (bucket *S3Bucket, close func()) {
+	server := httptest.NewServer(handler)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(true),
+	}))
+	return NewS3Bucket(s3.New(sess), lager.NewLogger("test"), DefaultRetryConfig, 2, SecureDefaultsConfig{}), server.Close
+}
+
+func objectBatch(keys ...string) []*s3.ObjectIdentifier {
+	objects := make([]*s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+	return objects
+}
+
+func TestPurgeDeletesEveryBatchFromProduce(t *testing.T) {
+	var deleteCalls int32
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&deleteCalls, 1)
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`))
+	})
+	defer close()
+
+	produce := func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		for _, keys := range [][]string{{"a"}, {"b"}, {"c"}} {
+			select {
+			case batches <- objectBatch(keys...):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	if err := bucket.purge(context.Background(), "my-bucket", "", produce); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&deleteCalls); got != 3 {
+		t.Fatalf("expected one DeleteObjects call per batch, got %d", got)
+	}
+}
+
+func TestPurgeAggregatesPerKeyFailures(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult>
+			<Error><Key>bad-key</Key><Code>AccessDenied</Code><Message>nope</Message></Error>
+		</DeleteResult>`))
+	})
+	defer close()
+
+	produce := func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		select {
+		case batches <- objectBatch("bad-key"):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	err := bucket.purge(context.Background(), "my-bucket", "", produce)
+	var deleteErr *DeleteObjectsError
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("expected a *DeleteObjectsError, got %v (%T)", err, err)
+	}
+	if len(deleteErr.Errors) != 1 || deleteErr.Errors[0].Key != "bad-key" {
+		t.Fatalf("expected the per-key failure to be reported, got %+v", deleteErr.Errors)
+	}
+}
+
+func TestPurgeCancelsProducerOnError(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "InternalError", http.StatusInternalServerError)
+	})
+	defer close()
+
+	produceErr := make(chan error, 1)
+	produce := func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		for i := 0; i < 50; i++ {
+			select {
+			case batches <- objectBatch("key"):
+			case <-ctx.Done():
+				produceErr <- ctx.Err()
+				return ctx.Err()
+			}
+		}
+		produceErr <- nil
+		return nil
+	}
+
+	if err := bucket.purge(context.Background(), "my-bucket", "", produce); err == nil {
+		t.Fatal("expected purge to surface the DeleteObjects failure")
+	}
+
+	if err := <-produceErr; err != context.Canceled {
+		t.Fatalf("expected purge to cancel the producer once a worker failed, got %v", err)
+	}
+}
+
+func TestPurgeReturnsProduceError(t *testing.T) {
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`))
+	})
+	defer close()
+
+	wantErr := errors.New("pagination failed")
+	produce := func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		return wantErr
+	}
+
+	if err := bucket.purge(context.Background(), "my-bucket", "", produce); err != wantErr {
+		t.Fatalf("expected produce's error to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package awss3
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func grant(granteeID, granteeURI, permission string) *s3.Grant {
+	grantee := &s3.Grantee{}
+	if granteeID != "" {
+		grantee.ID = aws.String(granteeID)
+	}
+	if granteeURI != "" {
+		grantee.URI = aws.String(granteeURI)
+	}
+	return &s3.Grant{Grantee: grantee, Permission: aws.String(permission)}
+}
+
+func TestReverseCannedACLPrivate(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{grant("owner-1", "", s3.PermissionFullControl)}
+
+	if got := reverseCannedACL(owner, grants); got != s3.BucketCannedACLPrivate {
+		t.Fatalf("expected %q, got %q", s3.BucketCannedACLPrivate, got)
+	}
+}
+
+func TestReverseCannedACLPublicRead(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{
+		grant("owner-1", "", s3.PermissionFullControl),
+		grant("", allUsersGroupURI, s3.PermissionRead),
+	}
+
+	if got := reverseCannedACL(owner, grants); got != s3.BucketCannedACLPublicRead {
+		t.Fatalf("expected %q, got %q", s3.BucketCannedACLPublicRead, got)
+	}
+}
+
+func TestReverseCannedACLPublicReadWrite(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{
+		grant("owner-1", "", s3.PermissionFullControl),
+		grant("", allUsersGroupURI, s3.PermissionRead),
+		grant("", allUsersGroupURI, s3.PermissionWrite),
+	}
+
+	if got := reverseCannedACL(owner, grants); got != s3.BucketCannedACLPublicReadWrite {
+		t.Fatalf("expected %q, got %q", s3.BucketCannedACLPublicReadWrite, got)
+	}
+}
+
+func TestReverseCannedACLAuthenticatedRead(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{
+		grant("owner-1", "", s3.PermissionFullControl),
+		grant("", authenticatedUsersGroupURI, s3.PermissionRead),
+	}
+
+	if got := reverseCannedACL(owner, grants); got != s3.BucketCannedACLAuthenticatedRead {
+		t.Fatalf("expected %q, got %q", s3.BucketCannedACLAuthenticatedRead, got)
+	}
+}
+
+func TestReverseCannedACLUnrecognizedGrantsReportEmpty(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{
+		grant("owner-1", "", s3.PermissionFullControl),
+		grant("some-other-account", "", s3.PermissionRead),
+	}
+
+	if got := reverseCannedACL(owner, grants); got != "" {
+		t.Fatalf("expected an unrecognized grant list to report \"\", got %q", got)
+	}
+}
+
+func TestReverseCannedACLMissingOwnerFullControlReportsEmpty(t *testing.T) {
+	owner := &s3.Owner{ID: aws.String("owner-1")}
+	grants := []*s3.Grant{grant("", allUsersGroupURI, s3.PermissionRead)}
+
+	if got := reverseCannedACL(owner, grants); got != "" {
+		t.Fatalf("expected a grant list missing the owner's FULL_CONTROL grant to report \"\", got %q", got)
+	}
+}
+
+func TestReconcileVersioningLeavesNeverRequestedAlone(t *testing.T) {
+	var calls int
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	defer close()
+
+	err := bucket.reconcileVersioning(context.Background(), "my-bucket", BucketDetails{Versioning: false}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request when versioning was never requested and isn't currently enabled, got %d", calls)
+	}
+}
+
+func TestReconcileCORSRulesSkipsPutWhenUnchanged(t *testing.T) {
+	var calls int
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	defer close()
+
+	rules := []CORSRule{{AllowedMethods: []string{"GET"}, AllowedOrigins: []string{"*"}}}
+	err := bucket.reconcileCORSRules(context.Background(), "my-bucket", BucketDetails{CORSRules: rules}, rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no request when the desired and current CORS rules match, got %d", calls)
+	}
+}
+
+func TestReconcileLifecycleDeletesWhenDesiredIsEmpty(t *testing.T) {
+	var deleteCalls int
+	bucket, close := newTestS3Bucket(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleteCalls++
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer close()
+
+	current := []LifecycleRule{{ID: "expire-old", Enabled: true, ExpirationDays: 30}}
+	err := bucket.reconcileLifecycle(context.Background(), "my-bucket", BucketDetails{Lifecycle: nil}, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleteCalls != 1 {
+		t.Fatalf("expected reconcileLifecycle to issue a single delete when the desired lifecycle is empty, got %d", deleteCalls)
+	}
+}
@@ -0,0 +1,87 @@
+package awss3
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// RetryConfig controls how aggressively retry retries a transient AWS
+// error. The zero value makes a single attempt with no retries; use
+// DefaultRetryConfig for retrying.
+type RetryConfig struct {
+	MaxAttempts int
+	MaxElapsed  time.Duration
+	BaseDelay   time.Duration
+}
+
+// DefaultRetryConfig is used wherever an operator has not overridden the
+// retry knobs in broker.Config.
+var DefaultRetryConfig = RetryConfig{
+	MaxAttempts: 5,
+	MaxElapsed:  2 * time.Minute,
+	BaseDelay:   500 * time.Millisecond,
+}
+
+// retryableErrCodes are AWS error codes caused by S3's eventual
+// consistency (a bucket not yet visible to every request router) or by
+// the service asking us to back off.
+var retryableErrCodes = map[string]bool{
+	"NoSuchBucket":         true,
+	"OperationAborted":     true,
+	"SlowDown":             true,
+	"RequestLimitExceeded": true,
+	"InternalError":        true,
+}
+
+func isRetryableErr(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	if retryableErrCodes[awsErr.Code()] {
+		return true
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() >= 500
+	}
+	return false
+}
+
+// retry calls fn, retrying on transient AWS errors with exponential
+// backoff and jitter until it succeeds, fn returns a non-retryable
+// error, config.MaxAttempts is reached, config.MaxElapsed has elapsed
+// since the first attempt, or ctx is cancelled.
+func retry(ctx context.Context, config RetryConfig, fn func() error) error {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+
+	start := time.Now()
+
+	var err error
+	for attempt := 0; attempt < config.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil || !isRetryableErr(err) {
+			return err
+		}
+
+		if time.Since(start) >= config.MaxElapsed {
+			return err
+		}
+
+		delay := config.BaseDelay * time.Duration(math.Pow(2, float64(attempt)))
+		delay += time.Duration(rand.Int63n(int64(config.BaseDelay) + 1))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,118 @@
+package awss3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func retryableErr() error {
+	return awserr.New("SlowDown", "please slow down", nil)
+}
+
+func TestRetryClampsMaxAttemptsToOne(t *testing.T) {
+	calls := 0
+	fn := func() error {
+		calls++
+		return retryableErr()
+	}
+
+	err := retry(context.Background(), RetryConfig{}, fn)
+	if err == nil {
+		t.Fatal("expected the retryable error to be returned, got nil")
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to be called once with a zero-value config, got %d calls", calls)
+	}
+}
+
+func TestRetryStopsOnNonRetryableError(t *testing.T) {
+	calls := 0
+	wantErr := errors.New("boom")
+	fn := func() error {
+		calls++
+		return wantErr
+	}
+
+	config := RetryConfig{MaxAttempts: 5, MaxElapsed: time.Minute, BaseDelay: time.Millisecond}
+	if err := retry(context.Background(), config, fn); err != wantErr {
+		t.Fatalf("expected non-retryable error to be returned unchanged, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to be called once, got %d calls", calls)
+	}
+}
+
+func TestRetryStopsAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	fn := func() error {
+		calls++
+		return retryableErr()
+	}
+
+	config := RetryConfig{MaxAttempts: 3, MaxElapsed: time.Minute, BaseDelay: time.Millisecond}
+	if err := retry(context.Background(), config, fn); err == nil {
+		t.Fatal("expected the last retryable error to be returned")
+	}
+	if calls != 3 {
+		t.Fatalf("expected fn to be called MaxAttempts times, got %d calls", calls)
+	}
+}
+
+func TestRetrySucceedsAfterTransientErrors(t *testing.T) {
+	calls := 0
+	fn := func() error {
+		calls++
+		if calls < 3 {
+			return retryableErr()
+		}
+		return nil
+	}
+
+	config := RetryConfig{MaxAttempts: 5, MaxElapsed: time.Minute, BaseDelay: time.Millisecond}
+	if err := retry(context.Background(), config, fn); err != nil {
+		t.Fatalf("expected eventual success, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected fn to stop retrying once it succeeds, got %d calls", calls)
+	}
+}
+
+func TestRetryRespectsContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	fn := func() error {
+		calls++
+		if calls == 1 {
+			cancel()
+		}
+		return retryableErr()
+	}
+
+	config := RetryConfig{MaxAttempts: 5, MaxElapsed: time.Minute, BaseDelay: time.Millisecond}
+	if err := retry(ctx, config, fn); err != context.Canceled {
+		t.Fatalf("expected ctx.Err() once cancelled, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected retry to stop immediately after cancellation, got %d calls", calls)
+	}
+}
+
+func TestRetryStopsAfterMaxElapsed(t *testing.T) {
+	calls := 0
+	fn := func() error {
+		calls++
+		return retryableErr()
+	}
+
+	config := RetryConfig{MaxAttempts: 100, MaxElapsed: 0, BaseDelay: time.Millisecond}
+	if err := retry(context.Background(), config, fn); err == nil {
+		t.Fatal("expected the retryable error to be returned once MaxElapsed has passed")
+	}
+	if calls != 1 {
+		t.Fatalf("expected retry to give up after the first attempt once MaxElapsed is exceeded, got %d calls", calls)
+	}
+}
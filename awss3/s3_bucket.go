@@ -2,8 +2,13 @@ package awss3
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"text/template"
 
 	"code.cloudfoundry.org/lager"
@@ -12,115 +17,279 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// DefaultDeleteConcurrency is used wherever an operator has not
+// overridden DeleteConcurrency in broker.Config.
+const DefaultDeleteConcurrency = 8
+
+// denyInsecureTransportSid identifies the statement SecureDefaultsConfig
+// merges into every bucket's policy, so Describe can recognize it.
+const denyInsecureTransportSid = "DenyInsecureTransport"
+
+// SecureDefaultsConfig is the hardening S3Bucket.Create applies to every
+// bucket unless BucketDetails.DisableSecureDefaults is set.
+type SecureDefaultsConfig struct {
+	Enabled bool
+	// KMSMasterKeyID selects SSE-KMS as the default encryption when
+	// set; otherwise the default is SSE-S3 (AES256).
+	KMSMasterKeyID string
+	// ObjectOwnership, if non-empty, is applied via
+	// PutBucketOwnershipControls.
+	ObjectOwnership string
+}
+
 type S3Bucket struct {
-	s3svc  *s3.S3
-	logger lager.Logger
+	s3svc             *s3.S3
+	logger            lager.Logger
+	retryConfig       RetryConfig
+	deleteConcurrency int
+	secureDefaults    SecureDefaultsConfig
 }
 
 func NewS3Bucket(
 	s3svc *s3.S3,
 	logger lager.Logger,
+	retryConfig RetryConfig,
+	deleteConcurrency int,
+	secureDefaults SecureDefaultsConfig,
 ) *S3Bucket {
+	if deleteConcurrency <= 0 {
+		deleteConcurrency = DefaultDeleteConcurrency
+	}
+
 	return &S3Bucket{
-		s3svc:  s3svc,
-		logger: logger.Session("s3-bucket"),
+		s3svc:             s3svc,
+		secureDefaults:    secureDefaults,
+		logger:            logger.Session("s3-bucket"),
+		retryConfig:       retryConfig,
+		deleteConcurrency: deleteConcurrency,
 	}
 }
 
-func (s *S3Bucket) Describe(bucketName, partition string) (BucketDetails, error) {
+func (s *S3Bucket) Describe(ctx context.Context, bucketName, partition string) (BucketDetails, error) {
 	getLocationInput := &s3.GetBucketLocationInput{
 		Bucket: aws.String(bucketName),
 	}
 	s.logger.Debug("get-bucket-location", lager.Data{"input": getLocationInput})
 
-	getLocationOutput, err := s.s3svc.GetBucketLocation(getLocationInput)
+	var getLocationOutput *s3.GetBucketLocationOutput
+	err := retry(ctx, s.retryConfig, func() error {
+		var err error
+		getLocationOutput, err = s.s3svc.GetBucketLocation(getLocationInput)
+		return err
+	})
 	if err != nil {
 		s.logger.Error("aws-s3-error", err)
-		if awsErr, ok := err.(awserr.Error); ok {
-			return BucketDetails{}, errors.New(awsErr.Code() + ": " + awsErr.Message())
-		}
-		return BucketDetails{}, err
+		return BucketDetails{}, wrapAWSError(err)
 	}
 	s.logger.Debug("get-bucket-location", lager.Data{"output": getLocationOutput})
 
-	return s.buildBucketDetails(bucketName, *getLocationOutput.LocationConstraint, partition, nil), nil
+	bucketDetails := s.buildBucketDetails(bucketName, *getLocationOutput.LocationConstraint, partition, nil)
+
+	policy, err := s.getPolicy(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.Policy = policy
+
+	acl, err := s.getACL(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.ACL = acl
+
+	corsRules, err := s.getCORSRules(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.CORSRules = corsRules
+
+	versioning, err := s.getVersioning(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.Versioning = versioning
+
+	encryption, err := s.getEncryption(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.ServerSideEncryption = encryption
+
+	logging, err := s.getLogging(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.Logging = logging
+
+	lifecycle, err := s.getLifecycle(bucketName)
+	if err != nil {
+		return BucketDetails{}, err
+	}
+	bucketDetails.Lifecycle = lifecycle
+
+	if s.secureDefaults.Enabled {
+		drift, err := s.secureDefaultsDrift(bucketName, bucketDetails)
+		if err != nil {
+			return BucketDetails{}, err
+		}
+		bucketDetails.SecureDefaultsDrift = drift
+	}
+
+	return bucketDetails, nil
 }
 
-func (s *S3Bucket) Create(bucketName string, bucketDetails BucketDetails) (string, error) {
+func (s *S3Bucket) Create(ctx context.Context, bucketName string, bucketDetails BucketDetails) (string, error) {
 	createBucketInput := s.buildCreateBucketInput(bucketName, bucketDetails)
 	s.logger.Debug("create-bucket", lager.Data{"input": createBucketInput})
 
 	createBucketOutput, err := s.s3svc.CreateBucket(createBucketInput)
 	if err != nil {
 		s.logger.Error("aws-s3-error", err)
-		if awsErr, ok := err.(awserr.Error); ok {
-			return "", errors.New(awsErr.Code() + ": " + awsErr.Message())
-		}
-		return "", err
+		return "", wrapAWSError(err)
 	}
 	s.logger.Debug("create-bucket", lager.Data{"output": createBucketOutput})
 
-	if len(bucketDetails.Policy) > 0 {
-		bucketDetails.BucketName = bucketName
-		tmpl, err := template.New("policy").Parse(bucketDetails.Policy)
-		if err != nil {
-			s.logger.Error("aws-s3-error", err)
-			return "", err
-		}
-		policy := bytes.Buffer{}
-		err = tmpl.Execute(&policy, bucketDetails)
-		if err != nil {
-			s.logger.Error("aws-s3-error", err)
-			return "", err
-		}
-		putPolicyInput := &s3.PutBucketPolicyInput{
-			Bucket: aws.String(bucketDetails.BucketName),
-			Policy: aws.String(policy.String()),
-		}
-		s.logger.Debug("put-bucket-policy", lager.Data{"input": putPolicyInput})
-		putPolicyOutput, err := s.s3svc.PutBucketPolicy(putPolicyInput)
-		if err != nil {
-			s.logger.Error("aws-s3-error", err)
-			if awsErr, ok := err.(awserr.Error); ok {
-				return "", errors.New(awsErr.Code() + ": " + awsErr.Message())
-			}
-			return "", err
-		}
-		s.logger.Debug("put-bucket-policy", lager.Data{"output": putPolicyOutput})
+	bucketDetails.BucketName = bucketName
+
+	bucketDetails, err = s.applySecureDefaults(bucketName, bucketDetails)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.reconcilePolicy(ctx, bucketName, bucketDetails, ""); err != nil {
+		return "", err
+	}
+	if err := s.reconcileACL(ctx, bucketName, bucketDetails); err != nil {
+		return "", err
+	}
+	if err := s.reconcileCORSRules(ctx, bucketName, bucketDetails, nil); err != nil {
+		return "", err
+	}
+	if err := s.reconcileVersioning(ctx, bucketName, bucketDetails, false); err != nil {
+		return "", err
+	}
+	if err := s.reconcileEncryption(ctx, bucketName, bucketDetails, nil); err != nil {
+		return "", err
+	}
+	if err := s.reconcileLogging(ctx, bucketName, bucketDetails, nil); err != nil {
+		return "", err
+	}
+	if err := s.reconcileLifecycle(ctx, bucketName, bucketDetails, nil); err != nil {
+		return "", err
+	}
+	if err := s.putPublicAccessBlock(ctx, bucketName, bucketDetails); err != nil {
+		return "", err
+	}
+	if err := s.putOwnershipControls(ctx, bucketName, bucketDetails.ObjectOwnership); err != nil {
+		return "", err
 	}
 
 	return aws.StringValue(createBucketOutput.Location), nil
 }
 
-func (s *S3Bucket) Modify(bucketName string, bucketDetails BucketDetails) error {
-	// TODO Implement modifx
-	return nil
-}
+func (s *S3Bucket) Modify(ctx context.Context, bucketName string, bucketDetails BucketDetails) error {
+	bucketDetails.BucketName = bucketName
+
+	currentPolicy, err := s.getPolicy(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := s.reconcilePolicy(ctx, bucketName, bucketDetails, currentPolicy); err != nil {
+		return err
+	}
+
+	if err := s.reconcileACL(ctx, bucketName, bucketDetails); err != nil {
+		return err
+	}
+
+	currentCORSRules, err := s.getCORSRules(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := s.reconcileCORSRules(ctx, bucketName, bucketDetails, currentCORSRules); err != nil {
+		return err
+	}
+
+	currentVersioning, err := s.getVersioning(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := s.reconcileVersioning(ctx, bucketName, bucketDetails, currentVersioning); err != nil {
+		return err
+	}
+
+	currentEncryption, err := s.getEncryption(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := s.reconcileEncryption(ctx, bucketName, bucketDetails, currentEncryption); err != nil {
+		return err
+	}
+
+	currentLogging, err := s.getLogging(bucketName)
+	if err != nil {
+		return err
+	}
+	if err := s.reconcileLogging(ctx, bucketName, bucketDetails, currentLogging); err != nil {
+		return err
+	}
 
-func (s *S3Bucket) Delete(bucketName string) error {
-	err := s.clear(bucketName)
+	currentLifecycle, err := s.getLifecycle(bucketName)
 	if err != nil {
 		return err
 	}
+	if err := s.reconcileLifecycle(ctx, bucketName, bucketDetails, currentLifecycle); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) Delete(ctx context.Context, bucketName string, bucketDetails BucketDetails) error {
+	if bucketDetails.Force {
+		switch bucketDetails.DeletePolicy {
+		case DeletePolicyPurge:
+			if err := s.clearVersions(ctx, bucketName, bucketDetails.MFA); err != nil {
+				return err
+			}
+			fallthrough
+		case DeletePolicyEmptyOnly:
+			if err := s.clearObjects(ctx, bucketName); err != nil {
+				return err
+			}
+		}
+	}
+
+	if bucketDetails.DeletePolicy == DeletePolicyRetain || bucketDetails.DeletePolicy == "" {
+		empty, err := s.isEmpty(bucketName)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return ErrBucketNotEmpty
+		}
+	}
 
 	deleteBucketInput := &s3.DeleteBucketInput{
 		Bucket: aws.String(bucketName),
 	}
 	s.logger.Debug("delete-bucket", lager.Data{"input": deleteBucketInput})
 
-	deleteBucketOutput, err := s.s3svc.DeleteBucket(deleteBucketInput)
+	var deleteBucketOutput *s3.DeleteBucketOutput
+	err := retry(ctx, s.retryConfig, func() error {
+		var err error
+		deleteBucketOutput, err = s.s3svc.DeleteBucket(deleteBucketInput)
+		return err
+	})
 	if err != nil {
 		s.logger.Error("aws-s3-error", err)
-		if awsErr, ok := err.(awserr.Error); ok {
-			if reqErr, ok := err.(awserr.RequestFailure); ok {
-				// AWS S3 returns a 400 if Bucket is not found
-				if reqErr.StatusCode() == 400 || reqErr.StatusCode() == 404 {
-					return ErrBucketDoesNotExist
-				}
+		if reqErr, ok := err.(awserr.RequestFailure); ok {
+			// AWS S3 returns a 400 if Bucket is not found
+			if reqErr.StatusCode() == 400 || reqErr.StatusCode() == 404 {
+				return ErrBucketDoesNotExist
 			}
-			return errors.New(awsErr.Code() + ": " + awsErr.Message())
 		}
-		return err
+		return wrapAWSError(err)
 	}
 	s.logger.Debug("delete-bucket", lager.Data{"output": deleteBucketOutput})
 
@@ -142,125 +311,1171 @@ func (s *S3Bucket) buildCreateBucketInput(bucketName string, bucketDetails Bucke
 	return createBucketInput
 }
 
-func (s *S3Bucket) clear(bucketName string) error {
-	err := s.clearObjects(bucketName)
+// renderPolicy executes the bucket's policy template, making the bucket
+// details (bucket name, ARN, region, tags) available to it.
+func (s *S3Bucket) renderPolicy(bucketDetails BucketDetails) (string, error) {
+	if len(bucketDetails.Policy) == 0 {
+		return "", nil
+	}
+
+	tmpl, err := template.New("policy").Parse(bucketDetails.Policy)
 	if err != nil {
-		return err
+		s.logger.Error("aws-s3-error", err)
+		return "", err
+	}
+
+	policy := bytes.Buffer{}
+	if err := tmpl.Execute(&policy, bucketDetails); err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return "", err
 	}
 
-	return s.clearVersions(bucketName)
+	return policy.String(), nil
 }
 
-func (s *S3Bucket) clearObjects(bucketName string) error {
-	var (
-		marker  *string
-		objects []*s3.ObjectIdentifier
-	)
+func (s *S3Bucket) getPolicy(bucketName string) (string, error) {
+	getPolicyInput := &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-policy", lager.Data{"input": getPolicyInput})
 
-	for {
-		listObjectsInput := &s3.ListObjectsInput{
-			Bucket:  aws.String(bucketName),
-			MaxKeys: aws.Int64(1000),
-			Marker:  marker,
+	getPolicyOutput, err := s.s3svc.GetBucketPolicy(getPolicyInput)
+	if err != nil {
+		if isAWSErrCode(err, "NoSuchBucketPolicy") {
+			return "", nil
 		}
-		s.logger.Debug("list-objects", lager.Data{"input": listObjectsInput})
+		s.logger.Error("aws-s3-error", err)
+		return "", wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-policy", lager.Data{"output": getPolicyOutput})
 
-		listObjectsOutput, err := s.s3svc.ListObjects(listObjectsInput)
-		if err != nil {
-			s.logger.Error("aws-s3-error", err)
-			if awsErr, ok := err.(awserr.Error); ok {
-				return errors.New(awsErr.Code() + ": " + awsErr.Message())
-			}
-			return err
-		}
+	return aws.StringValue(getPolicyOutput.Policy), nil
+}
 
-		objects = []*s3.ObjectIdentifier{}
-		for _, object := range listObjectsOutput.Contents {
-			objects = append(objects, &s3.ObjectIdentifier{
-				Key: object.Key,
-			})
-		}
+func (s *S3Bucket) reconcilePolicy(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentPolicy string) error {
+	desiredPolicy, err := s.renderPolicy(bucketDetails)
+	if err != nil {
+		return err
+	}
 
-		if len(objects) > 0 {
-			deleteObjectsInput := &s3.DeleteObjectsInput{
-				Bucket: aws.String(bucketName),
-				Delete: &s3.Delete{Objects: objects},
-			}
-			s.logger.Debug("delete-versions", lager.Data{"input": deleteObjectsInput})
+	if desiredPolicy == "" {
+		if currentPolicy == "" {
+			return nil
+		}
 
-			_, err = s.s3svc.DeleteObjects(deleteObjectsInput)
-			if err != nil {
-				s.logger.Error("aws-s3-error", err)
-				if awsErr, ok := err.(awserr.Error); ok {
-					return errors.New(awsErr.Code() + ": " + awsErr.Message())
-				}
-				return err
-			}
+		deletePolicyInput := &s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(bucketName),
 		}
+		s.logger.Debug("delete-bucket-policy", lager.Data{"input": deletePolicyInput})
 
-		if aws.StringValue(listObjectsOutput.Marker) == "" {
-			break
+		if _, err := s.s3svc.DeleteBucketPolicy(deletePolicyInput); err != nil {
+			s.logger.Error("aws-s3-error", err)
+			return wrapAWSError(err)
 		}
+		return nil
+	}
+
+	if desiredPolicy == currentPolicy {
+		return nil
+	}
+
+	putPolicyInput := &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+		Policy: aws.String(desiredPolicy),
+	}
+	s.logger.Debug("put-bucket-policy", lager.Data{"input": putPolicyInput})
+
+	// A policy put can race S3's eventual consistency right after
+	// CreateBucket, failing with NoSuchBucket for a few seconds.
+	var putPolicyOutput *s3.PutBucketPolicyOutput
+	err = retry(ctx, s.retryConfig, func() error {
+		var err error
+		putPolicyOutput, err = s.s3svc.PutBucketPolicy(putPolicyInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
 	}
+	s.logger.Debug("put-bucket-policy", lager.Data{"output": putPolicyOutput})
 
 	return nil
 }
 
-func (s *S3Bucket) clearVersions(bucketName string) error {
-	var (
-		keyMarker       *string
-		versionIdMarker *string
-		objects         []*s3.ObjectIdentifier
-	)
+// allUsersGroupURI and authenticatedUsersGroupURI identify the grantee
+// groups GetBucketAcl reports public-read and authenticated-read grants
+// against, so getACL can reverse a canned ACL out of the raw grant list.
+const (
+	allUsersGroupURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersGroupURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// getACL fetches the bucket's ACL and reverses it back into one of the
+// canned ACL names Create/reconcileACL accept. S3 only ever reports an
+// ACL as a grant list, not the canned name that produced it, so this is
+// a best-effort match against the grants a canned ACL would produce; an
+// ACL that was never one of the canned forms (e.g. hand-crafted grants
+// to specific AWS accounts) reports as "".
+func (s *S3Bucket) getACL(bucketName string) (string, error) {
+	getACLInput := &s3.GetBucketAclInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-acl", lager.Data{"input": getACLInput})
+
+	getACLOutput, err := s.s3svc.GetBucketAcl(getACLInput)
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return "", wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-acl", lager.Data{"output": getACLOutput})
+
+	return reverseCannedACL(getACLOutput.Owner, getACLOutput.Grants), nil
+}
 
-	for {
-		listVersionsInput := &s3.ListObjectVersionsInput{
-			Bucket:          aws.String(bucketName),
-			KeyMarker:       keyMarker,
-			VersionIdMarker: versionIdMarker,
+// reverseCannedACL matches owner/grants against the grant lists S3
+// produces for each canned ACL, returning the matching canned name or
+// "" if the grants don't correspond to one.
+func reverseCannedACL(owner *s3.Owner, grants []*s3.Grant) string {
+	var ownerFullControl, allUsersRead, allUsersWrite, authUsersRead bool
+	extraGrants := false
+
+	for _, grant := range grants {
+		if grant == nil || grant.Grantee == nil {
+			continue
 		}
-		s.logger.Debug("list-versions", lager.Data{"input": listVersionsInput})
 
-		listVersionsOutput, err := s.s3svc.ListObjectVersions(listVersionsInput)
-		if err != nil {
-			s.logger.Error("aws-s3-error", err)
-			if awsErr, ok := err.(awserr.Error); ok {
-				return errors.New(awsErr.Code() + ": " + awsErr.Message())
+		switch {
+		case aws.StringValue(grant.Grantee.ID) != "" && owner != nil && aws.StringValue(grant.Grantee.ID) == aws.StringValue(owner.ID):
+			if aws.StringValue(grant.Permission) == s3.PermissionFullControl {
+				ownerFullControl = true
+				continue
 			}
-			return err
+			extraGrants = true
+		case aws.StringValue(grant.Grantee.URI) == allUsersGroupURI:
+			switch aws.StringValue(grant.Permission) {
+			case s3.PermissionRead:
+				allUsersRead = true
+			case s3.PermissionWrite:
+				allUsersWrite = true
+			default:
+				extraGrants = true
+			}
+		case aws.StringValue(grant.Grantee.URI) == authenticatedUsersGroupURI:
+			if aws.StringValue(grant.Permission) == s3.PermissionRead {
+				authUsersRead = true
+			} else {
+				extraGrants = true
+			}
+		default:
+			extraGrants = true
 		}
+	}
+
+	if !ownerFullControl || extraGrants {
+		return ""
+	}
+
+	switch {
+	case allUsersRead && allUsersWrite:
+		return s3.BucketCannedACLPublicReadWrite
+	case allUsersRead:
+		return s3.BucketCannedACLPublicRead
+	case authUsersRead:
+		return s3.BucketCannedACLAuthenticatedRead
+	default:
+		return s3.BucketCannedACLPrivate
+	}
+}
+
+func (s *S3Bucket) reconcileACL(ctx context.Context, bucketName string, bucketDetails BucketDetails) error {
+	if bucketDetails.ACL == "" {
+		return nil
+	}
+
+	putACLInput := &s3.PutBucketAclInput{
+		Bucket: aws.String(bucketName),
+		ACL:    aws.String(bucketDetails.ACL),
+	}
+	s.logger.Debug("put-bucket-acl", lager.Data{"input": putACLInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	var putACLOutput *s3.PutBucketAclOutput
+	err := retry(ctx, s.retryConfig, func() error {
+		var err error
+		putACLOutput, err = s.s3svc.PutBucketAcl(putACLInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+	s.logger.Debug("put-bucket-acl", lager.Data{"output": putACLOutput})
+
+	return nil
+}
+
+func (s *S3Bucket) getCORSRules(bucketName string) ([]CORSRule, error) {
+	getCorsInput := &s3.GetBucketCorsInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-cors", lager.Data{"input": getCorsInput})
 
-		objects = []*s3.ObjectIdentifier{}
-		for _, version := range listVersionsOutput.Versions {
-			objects = append(objects, &s3.ObjectIdentifier{
-				Key:       version.Key,
-				VersionId: version.VersionId,
-			})
+	getCorsOutput, err := s.s3svc.GetBucketCors(getCorsInput)
+	if err != nil {
+		if isAWSErrCode(err, "NoSuchCORSConfiguration") {
+			return nil, nil
 		}
+		s.logger.Error("aws-s3-error", err)
+		return nil, wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-cors", lager.Data{"output": getCorsOutput})
 
-		if len(objects) > 0 {
-			deleteObjectsInput := &s3.DeleteObjectsInput{
-				Bucket: aws.String(bucketName),
-				Delete: &s3.Delete{Objects: objects},
-			}
-			s.logger.Debug("delete-versions", lager.Data{"input": deleteObjectsInput})
+	corsRules := make([]CORSRule, 0, len(getCorsOutput.CORSRules))
+	for _, rule := range getCorsOutput.CORSRules {
+		corsRules = append(corsRules, CORSRule{
+			AllowedHeaders: aws.StringValueSlice(rule.AllowedHeaders),
+			AllowedMethods: aws.StringValueSlice(rule.AllowedMethods),
+			AllowedOrigins: aws.StringValueSlice(rule.AllowedOrigins),
+			ExposeHeaders:  aws.StringValueSlice(rule.ExposeHeaders),
+			MaxAgeSeconds:  aws.Int64Value(rule.MaxAgeSeconds),
+		})
+	}
 
-			_, err = s.s3svc.DeleteObjects(deleteObjectsInput)
-			if err != nil {
-				s.logger.Error("aws-s3-error", err)
-				if awsErr, ok := err.(awserr.Error); ok {
-					return errors.New(awsErr.Code() + ": " + awsErr.Message())
-				}
-				return err
-			}
+	return corsRules, nil
+}
+
+func (s *S3Bucket) buildCORSRules(corsRules []CORSRule) []*s3.CORSRule {
+	rules := make([]*s3.CORSRule, 0, len(corsRules))
+	for _, rule := range corsRules {
+		rules = append(rules, &s3.CORSRule{
+			AllowedHeaders: aws.StringSlice(rule.AllowedHeaders),
+			AllowedMethods: aws.StringSlice(rule.AllowedMethods),
+			AllowedOrigins: aws.StringSlice(rule.AllowedOrigins),
+			ExposeHeaders:  aws.StringSlice(rule.ExposeHeaders),
+			MaxAgeSeconds:  aws.Int64(rule.MaxAgeSeconds),
+		})
+	}
+	return rules
+}
+
+func (s *S3Bucket) reconcileCORSRules(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentCORSRules []CORSRule) error {
+	if reflect.DeepEqual(bucketDetails.CORSRules, currentCORSRules) {
+		return nil
+	}
+
+	if len(bucketDetails.CORSRules) == 0 {
+		if len(currentCORSRules) == 0 {
+			return nil
+		}
+
+		deleteCorsInput := &s3.DeleteBucketCorsInput{
+			Bucket: aws.String(bucketName),
 		}
+		s.logger.Debug("delete-bucket-cors", lager.Data{"input": deleteCorsInput})
 
-		keyMarker = listVersionsOutput.NextKeyMarker
-		versionIdMarker = listVersionsOutput.VersionIdMarker
-		if aws.StringValue(keyMarker) == "" && aws.StringValue(versionIdMarker) == "" {
-			break
+		// A delete can race S3's eventual consistency right after
+		// CreateBucket, failing with NoSuchBucket for a few seconds.
+		err := retry(ctx, s.retryConfig, func() error {
+			_, err := s.s3svc.DeleteBucketCors(deleteCorsInput)
+			return err
+		})
+		if err != nil {
+			s.logger.Error("aws-s3-error", err)
+			return wrapAWSError(err)
 		}
+		return nil
+	}
+
+	putCorsInput := &s3.PutBucketCorsInput{
+		Bucket: aws.String(bucketName),
+		CORSConfiguration: &s3.CORSConfiguration{
+			CORSRules: s.buildCORSRules(bucketDetails.CORSRules),
+		},
+	}
+	s.logger.Debug("put-bucket-cors", lager.Data{"input": putCorsInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketCors(putCorsInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
 	}
 
 	return nil
 }
+
+func (s *S3Bucket) getVersioning(bucketName string) (bool, error) {
+	getVersioningInput := &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-versioning", lager.Data{"input": getVersioningInput})
+
+	getVersioningOutput, err := s.s3svc.GetBucketVersioning(getVersioningInput)
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return false, wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-versioning", lager.Data{"output": getVersioningOutput})
+
+	return aws.StringValue(getVersioningOutput.Status) == s3.BucketVersioningStatusEnabled, nil
+}
+
+func (s *S3Bucket) reconcileVersioning(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentVersioning bool) error {
+	if bucketDetails.Versioning == currentVersioning {
+		return nil
+	}
+
+	status := s3.BucketVersioningStatusSuspended
+	if bucketDetails.Versioning {
+		status = s3.BucketVersioningStatusEnabled
+	}
+
+	// S3 has no "unset" state: a bucket that has never had versioning
+	// requested is simply left alone rather than explicitly suspended.
+	if !bucketDetails.Versioning && !currentVersioning {
+		return nil
+	}
+
+	putVersioningInput := &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucketName),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(status),
+		},
+	}
+	s.logger.Debug("put-bucket-versioning", lager.Data{"input": putVersioningInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketVersioning(putVersioningInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) getEncryption(bucketName string) (*ServerSideEncryption, error) {
+	getEncryptionInput := &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-encryption", lager.Data{"input": getEncryptionInput})
+
+	getEncryptionOutput, err := s.s3svc.GetBucketEncryption(getEncryptionInput)
+	if err != nil {
+		if isAWSErrCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+			return nil, nil
+		}
+		s.logger.Error("aws-s3-error", err)
+		return nil, wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-encryption", lager.Data{"output": getEncryptionOutput})
+
+	rules := getEncryptionOutput.ServerSideEncryptionConfiguration.Rules
+	if len(rules) == 0 || rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return nil, nil
+	}
+
+	def := rules[0].ApplyServerSideEncryptionByDefault
+	return &ServerSideEncryption{
+		SSEAlgorithm:   aws.StringValue(def.SSEAlgorithm),
+		KMSMasterKeyID: aws.StringValue(def.KMSMasterKeyID),
+	}, nil
+}
+
+func (s *S3Bucket) reconcileEncryption(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentEncryption *ServerSideEncryption) error {
+	if reflect.DeepEqual(bucketDetails.ServerSideEncryption, currentEncryption) {
+		return nil
+	}
+
+	if bucketDetails.ServerSideEncryption == nil {
+		if currentEncryption == nil {
+			return nil
+		}
+
+		deleteEncryptionInput := &s3.DeleteBucketEncryptionInput{
+			Bucket: aws.String(bucketName),
+		}
+		s.logger.Debug("delete-bucket-encryption", lager.Data{"input": deleteEncryptionInput})
+
+		// A delete can race S3's eventual consistency right after
+		// CreateBucket, failing with NoSuchBucket for a few seconds.
+		err := retry(ctx, s.retryConfig, func() error {
+			_, err := s.s3svc.DeleteBucketEncryption(deleteEncryptionInput)
+			return err
+		})
+		if err != nil {
+			s.logger.Error("aws-s3-error", err)
+			return wrapAWSError(err)
+		}
+		return nil
+	}
+
+	putEncryptionInput := &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{
+				{
+					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+						SSEAlgorithm:   aws.String(bucketDetails.ServerSideEncryption.SSEAlgorithm),
+						KMSMasterKeyID: stringOrNil(bucketDetails.ServerSideEncryption.KMSMasterKeyID),
+					},
+				},
+			},
+		},
+	}
+	s.logger.Debug("put-bucket-encryption", lager.Data{"input": putEncryptionInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketEncryption(putEncryptionInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) getLogging(bucketName string) (*LoggingConfig, error) {
+	getLoggingInput := &s3.GetBucketLoggingInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-logging", lager.Data{"input": getLoggingInput})
+
+	getLoggingOutput, err := s.s3svc.GetBucketLogging(getLoggingInput)
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return nil, wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-logging", lager.Data{"output": getLoggingOutput})
+
+	if getLoggingOutput.LoggingEnabled == nil {
+		return nil, nil
+	}
+
+	return &LoggingConfig{
+		TargetBucket: aws.StringValue(getLoggingOutput.LoggingEnabled.TargetBucket),
+		TargetPrefix: aws.StringValue(getLoggingOutput.LoggingEnabled.TargetPrefix),
+	}, nil
+}
+
+func (s *S3Bucket) reconcileLogging(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentLogging *LoggingConfig) error {
+	if reflect.DeepEqual(bucketDetails.Logging, currentLogging) {
+		return nil
+	}
+
+	putLoggingInput := &s3.PutBucketLoggingInput{
+		Bucket:              aws.String(bucketName),
+		BucketLoggingStatus: &s3.BucketLoggingStatus{},
+	}
+	if bucketDetails.Logging != nil {
+		putLoggingInput.BucketLoggingStatus.LoggingEnabled = &s3.LoggingEnabled{
+			TargetBucket: aws.String(bucketDetails.Logging.TargetBucket),
+			TargetPrefix: aws.String(bucketDetails.Logging.TargetPrefix),
+		}
+	}
+	s.logger.Debug("put-bucket-logging", lager.Data{"input": putLoggingInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketLogging(putLoggingInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) getLifecycle(bucketName string) ([]LifecycleRule, error) {
+	getLifecycleInput := &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-lifecycle-configuration", lager.Data{"input": getLifecycleInput})
+
+	getLifecycleOutput, err := s.s3svc.GetBucketLifecycleConfiguration(getLifecycleInput)
+	if err != nil {
+		if isAWSErrCode(err, "NoSuchLifecycleConfiguration") {
+			return nil, nil
+		}
+		s.logger.Error("aws-s3-error", err)
+		return nil, wrapAWSError(err)
+	}
+	s.logger.Debug("get-bucket-lifecycle-configuration", lager.Data{"output": getLifecycleOutput})
+
+	rules := make([]LifecycleRule, 0, len(getLifecycleOutput.Rules))
+	for _, rule := range getLifecycleOutput.Rules {
+		lifecycleRule := LifecycleRule{
+			ID:      aws.StringValue(rule.ID),
+			Enabled: aws.StringValue(rule.Status) == s3.ExpirationStatusEnabled,
+		}
+		if rule.Filter != nil {
+			lifecycleRule.Prefix = aws.StringValue(rule.Filter.Prefix)
+		} else {
+			lifecycleRule.Prefix = aws.StringValue(rule.Prefix)
+		}
+		if rule.Expiration != nil {
+			lifecycleRule.ExpirationDays = aws.Int64Value(rule.Expiration.Days)
+		}
+		if rule.NoncurrentVersionExpiration != nil {
+			lifecycleRule.NoncurrentVersionExpirationDays = aws.Int64Value(rule.NoncurrentVersionExpiration.NoncurrentDays)
+		}
+		if rule.AbortIncompleteMultipartUpload != nil {
+			lifecycleRule.AbortIncompleteMultipartUploadDays = aws.Int64Value(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		rules = append(rules, lifecycleRule)
+	}
+
+	return rules, nil
+}
+
+func (s *S3Bucket) buildLifecycleRules(lifecycle []LifecycleRule) []*s3.LifecycleRule {
+	rules := make([]*s3.LifecycleRule, 0, len(lifecycle))
+	for _, rule := range lifecycle {
+		status := s3.ExpirationStatusDisabled
+		if rule.Enabled {
+			status = s3.ExpirationStatusEnabled
+		}
+
+		lifecycleRule := &s3.LifecycleRule{
+			ID:     aws.String(rule.ID),
+			Status: aws.String(status),
+			Filter: &s3.LifecycleRuleFilter{
+				Prefix: aws.String(rule.Prefix),
+			},
+		}
+		if rule.ExpirationDays > 0 {
+			lifecycleRule.Expiration = &s3.LifecycleExpiration{
+				Days: aws.Int64(rule.ExpirationDays),
+			}
+		}
+		if rule.NoncurrentVersionExpirationDays > 0 {
+			lifecycleRule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int64(rule.NoncurrentVersionExpirationDays),
+			}
+		}
+		if rule.AbortIncompleteMultipartUploadDays > 0 {
+			lifecycleRule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int64(rule.AbortIncompleteMultipartUploadDays),
+			}
+		}
+
+		rules = append(rules, lifecycleRule)
+	}
+	return rules
+}
+
+func (s *S3Bucket) reconcileLifecycle(ctx context.Context, bucketName string, bucketDetails BucketDetails, currentLifecycle []LifecycleRule) error {
+	if reflect.DeepEqual(bucketDetails.Lifecycle, currentLifecycle) {
+		return nil
+	}
+
+	if len(bucketDetails.Lifecycle) == 0 {
+		if len(currentLifecycle) == 0 {
+			return nil
+		}
+
+		deleteLifecycleInput := &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(bucketName),
+		}
+		s.logger.Debug("delete-bucket-lifecycle", lager.Data{"input": deleteLifecycleInput})
+
+		// A delete can race S3's eventual consistency right after
+		// CreateBucket, failing with NoSuchBucket for a few seconds.
+		err := retry(ctx, s.retryConfig, func() error {
+			_, err := s.s3svc.DeleteBucketLifecycle(deleteLifecycleInput)
+			return err
+		})
+		if err != nil {
+			s.logger.Error("aws-s3-error", err)
+			return wrapAWSError(err)
+		}
+		return nil
+	}
+
+	putLifecycleInput := &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+			Rules: s.buildLifecycleRules(bucketDetails.Lifecycle),
+		},
+	}
+	s.logger.Debug("put-bucket-lifecycle-configuration", lager.Data{"input": putLifecycleInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketLifecycleConfiguration(putLifecycleInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+// applySecureDefaults returns bucketDetails with the operator's hardening
+// defaults filled in: a deny-insecure-transport statement merged into the
+// policy, and default server-side encryption if the plan didn't specify
+// one. It is a no-op if secure defaults are disabled globally or the
+// instance opted out.
+func (s *S3Bucket) applySecureDefaults(bucketName string, bucketDetails BucketDetails) (BucketDetails, error) {
+	if !s.secureDefaults.Enabled || bucketDetails.DisableSecureDefaults {
+		return bucketDetails, nil
+	}
+
+	policy, err := s.renderPolicy(bucketDetails)
+	if err != nil {
+		return bucketDetails, err
+	}
+	policy, err = mergeSecureTransportDeny(policy, bucketName)
+	if err != nil {
+		return bucketDetails, err
+	}
+	bucketDetails.Policy = policy
+
+	if bucketDetails.ServerSideEncryption == nil {
+		bucketDetails.ServerSideEncryption = &ServerSideEncryption{
+			SSEAlgorithm:   s3.ServerSideEncryptionAes256,
+			KMSMasterKeyID: s.secureDefaults.KMSMasterKeyID,
+		}
+		if s.secureDefaults.KMSMasterKeyID != "" {
+			bucketDetails.ServerSideEncryption.SSEAlgorithm = s3.ServerSideEncryptionAwsKms
+		}
+	}
+
+	if bucketDetails.ObjectOwnership == "" {
+		bucketDetails.ObjectOwnership = s.secureDefaults.ObjectOwnership
+	}
+
+	return bucketDetails, nil
+}
+
+// mergeSecureTransportDeny parses policy as a policy document (or starts
+// a fresh one if policy is empty) and appends a Deny statement that
+// rejects any request to bucketName made over plain HTTP, leaving every
+// other statement untouched.
+func mergeSecureTransportDeny(policy, bucketName string) (string, error) {
+	doc := struct {
+		Version   string            `json:"Version"`
+		Statement []json.RawMessage `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+	}
+
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+			return "", err
+		}
+	}
+
+	denyStatement, err := json.Marshal(map[string]interface{}{
+		"Sid":       denyInsecureTransportSid,
+		"Effect":    "Deny",
+		"Principal": "*",
+		"Action":    "s3:*",
+		"Resource": []string{
+			fmt.Sprintf("arn:aws:s3:::%s", bucketName),
+			fmt.Sprintf("arn:aws:s3:::%s/*", bucketName),
+		},
+		"Condition": map[string]interface{}{
+			"Bool": map[string]string{"aws:SecureTransport": "false"},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	doc.Statement = append(doc.Statement, denyStatement)
+
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(merged), nil
+}
+
+func (s *S3Bucket) putPublicAccessBlock(ctx context.Context, bucketName string, bucketDetails BucketDetails) error {
+	if !s.secureDefaults.Enabled || bucketDetails.DisableSecureDefaults {
+		return nil
+	}
+
+	putInput := &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	}
+	s.logger.Debug("put-public-access-block", lager.Data{"input": putInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutPublicAccessBlock(putInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) getPublicAccessBlock(bucketName string) (*s3.PublicAccessBlockConfiguration, error) {
+	getInput := &s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-public-access-block", lager.Data{"input": getInput})
+
+	getOutput, err := s.s3svc.GetPublicAccessBlock(getInput)
+	if err != nil {
+		if isAWSErrCode(err, "NoSuchPublicAccessBlockConfiguration") {
+			return nil, nil
+		}
+		s.logger.Error("aws-s3-error", err)
+		return nil, wrapAWSError(err)
+	}
+
+	return getOutput.PublicAccessBlockConfiguration, nil
+}
+
+func (s *S3Bucket) putOwnershipControls(ctx context.Context, bucketName, ownership string) error {
+	if ownership == "" {
+		return nil
+	}
+
+	putInput := &s3.PutBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+		OwnershipControls: &s3.OwnershipControls{
+			Rules: []*s3.OwnershipControlsRule{
+				{ObjectOwnership: aws.String(ownership)},
+			},
+		},
+	}
+	s.logger.Debug("put-bucket-ownership-controls", lager.Data{"input": putInput})
+
+	// A put can race S3's eventual consistency right after CreateBucket,
+	// failing with NoSuchBucket for a few seconds.
+	err := retry(ctx, s.retryConfig, func() error {
+		_, err := s.s3svc.PutBucketOwnershipControls(putInput)
+		return err
+	})
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return wrapAWSError(err)
+	}
+
+	return nil
+}
+
+func (s *S3Bucket) getOwnershipControls(bucketName string) (string, error) {
+	getInput := &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+	}
+	s.logger.Debug("get-bucket-ownership-controls", lager.Data{"input": getInput})
+
+	getOutput, err := s.s3svc.GetBucketOwnershipControls(getInput)
+	if err != nil {
+		if isAWSErrCode(err, "OwnershipControlsNotFoundError") {
+			return "", nil
+		}
+		s.logger.Error("aws-s3-error", err)
+		return "", wrapAWSError(err)
+	}
+
+	if len(getOutput.OwnershipControls.Rules) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(getOutput.OwnershipControls.Rules[0].ObjectOwnership), nil
+}
+
+// secureDefaultsDrift compares the hardening S3Bucket.Create applies
+// against the bucket's current state, so an operator can detect
+// tampering after provisioning.
+func (s *S3Bucket) secureDefaultsDrift(bucketName string, bucketDetails BucketDetails) (*SecureDefaultsDrift, error) {
+	publicAccessBlock, err := s.getPublicAccessBlock(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	publicAccessBlockMissing := publicAccessBlock == nil ||
+		!aws.BoolValue(publicAccessBlock.BlockPublicAcls) ||
+		!aws.BoolValue(publicAccessBlock.BlockPublicPolicy) ||
+		!aws.BoolValue(publicAccessBlock.IgnorePublicAcls) ||
+		!aws.BoolValue(publicAccessBlock.RestrictPublicBuckets)
+
+	ownership, err := s.getOwnershipControls(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecureDefaultsDrift{
+		PublicAccessBlockMissing:   publicAccessBlockMissing,
+		SecureTransportDenyMissing: !strings.Contains(bucketDetails.Policy, denyInsecureTransportSid),
+		EncryptionMissing:          bucketDetails.ServerSideEncryption == nil,
+		OwnershipControlsDrifted:   s.secureDefaults.ObjectOwnership != "" && ownership != s.secureDefaults.ObjectOwnership,
+	}, nil
+}
+
+// DeletePrefix removes every current-version object under prefix without
+// touching the rest of the bucket or the bucket itself, for instances
+// that share a bucket with other bindings. When purgeVersions is set,
+// noncurrent versions and delete markers under prefix are removed too,
+// mirroring Delete's DeletePolicyPurge; mfa carries the device serial
+// and code when the bucket's versioning is MFA-delete protected.
+func (s *S3Bucket) DeletePrefix(ctx context.Context, bucketName, prefix string, purgeVersions bool, mfa string) error {
+	// Scope the listing to prefix as a path segment, not a bare string
+	// match, so "tenant1" can't also match "tenant10/...".
+	scopedPrefix := prefix + "/"
+
+	if purgeVersions {
+		if err := s.purge(ctx, bucketName, mfa, func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+			var keyMarker, versionIdMarker *string
+
+			for {
+				listVersionsInput := &s3.ListObjectVersionsInput{
+					Bucket:          aws.String(bucketName),
+					Prefix:          aws.String(scopedPrefix),
+					KeyMarker:       keyMarker,
+					VersionIdMarker: versionIdMarker,
+				}
+				s.logger.Debug("list-versions", lager.Data{"input": listVersionsInput})
+
+				listVersionsOutput, err := s.s3svc.ListObjectVersions(listVersionsInput)
+				if err != nil {
+					s.logger.Error("aws-s3-error", err)
+					return wrapAWSError(err)
+				}
+
+				objects := make([]*s3.ObjectIdentifier, 0, len(listVersionsOutput.Versions)+len(listVersionsOutput.DeleteMarkers))
+				for _, version := range listVersionsOutput.Versions {
+					objects = append(objects, &s3.ObjectIdentifier{
+						Key:       version.Key,
+						VersionId: version.VersionId,
+					})
+				}
+				for _, marker := range listVersionsOutput.DeleteMarkers {
+					objects = append(objects, &s3.ObjectIdentifier{
+						Key:       marker.Key,
+						VersionId: marker.VersionId,
+					})
+				}
+
+				if len(objects) > 0 {
+					if err := sendBatch(ctx, batches, objects); err != nil {
+						return err
+					}
+				}
+
+				keyMarker = listVersionsOutput.NextKeyMarker
+				versionIdMarker = listVersionsOutput.NextVersionIdMarker
+				if !aws.BoolValue(listVersionsOutput.IsTruncated) {
+					return nil
+				}
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	return s.purge(ctx, bucketName, "", func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		var continuationToken *string
+
+		for {
+			listObjectsInput := &s3.ListObjectsV2Input{
+				Bucket:            aws.String(bucketName),
+				Prefix:            aws.String(scopedPrefix),
+				MaxKeys:           aws.Int64(1000),
+				ContinuationToken: continuationToken,
+			}
+			s.logger.Debug("list-objects-v2", lager.Data{"input": listObjectsInput})
+
+			listObjectsOutput, err := s.s3svc.ListObjectsV2(listObjectsInput)
+			if err != nil {
+				s.logger.Error("aws-s3-error", err)
+				return wrapAWSError(err)
+			}
+
+			if len(listObjectsOutput.Contents) > 0 {
+				objects := make([]*s3.ObjectIdentifier, 0, len(listObjectsOutput.Contents))
+				for _, object := range listObjectsOutput.Contents {
+					objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+				}
+				if err := sendBatch(ctx, batches, objects); err != nil {
+					return err
+				}
+			}
+
+			if !aws.BoolValue(listObjectsOutput.IsTruncated) {
+				return nil
+			}
+			continuationToken = listObjectsOutput.NextContinuationToken
+		}
+	})
+}
+
+// isEmpty reports whether the bucket has no current-version objects,
+// noncurrent versions, or delete markers.
+func (s *S3Bucket) isEmpty(bucketName string) (bool, error) {
+	listObjectsInput := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketName),
+		MaxKeys: aws.Int64(1),
+	}
+	s.logger.Debug("list-objects-v2", lager.Data{"input": listObjectsInput})
+
+	listObjectsOutput, err := s.s3svc.ListObjectsV2(listObjectsInput)
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return false, wrapAWSError(err)
+	}
+	if len(listObjectsOutput.Contents) > 0 {
+		return false, nil
+	}
+
+	listVersionsInput := &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(bucketName),
+		MaxKeys: aws.Int64(1),
+	}
+	s.logger.Debug("list-object-versions", lager.Data{"input": listVersionsInput})
+
+	listVersionsOutput, err := s.s3svc.ListObjectVersions(listVersionsInput)
+	if err != nil {
+		s.logger.Error("aws-s3-error", err)
+		return false, wrapAWSError(err)
+	}
+
+	return len(listVersionsOutput.Versions) == 0 && len(listVersionsOutput.DeleteMarkers) == 0, nil
+}
+
+// clearObjects removes every current-version object in the bucket.
+func (s *S3Bucket) clearObjects(ctx context.Context, bucketName string) error {
+	return s.purge(ctx, bucketName, "", func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		var continuationToken *string
+
+		for {
+			listObjectsInput := &s3.ListObjectsV2Input{
+				Bucket:            aws.String(bucketName),
+				MaxKeys:           aws.Int64(1000),
+				ContinuationToken: continuationToken,
+			}
+			s.logger.Debug("list-objects-v2", lager.Data{"input": listObjectsInput})
+
+			listObjectsOutput, err := s.s3svc.ListObjectsV2(listObjectsInput)
+			if err != nil {
+				s.logger.Error("aws-s3-error", err)
+				return wrapAWSError(err)
+			}
+
+			if len(listObjectsOutput.Contents) > 0 {
+				objects := make([]*s3.ObjectIdentifier, 0, len(listObjectsOutput.Contents))
+				for _, object := range listObjectsOutput.Contents {
+					objects = append(objects, &s3.ObjectIdentifier{Key: object.Key})
+				}
+				if err := sendBatch(ctx, batches, objects); err != nil {
+					return err
+				}
+			}
+
+			if !aws.BoolValue(listObjectsOutput.IsTruncated) {
+				return nil
+			}
+			continuationToken = listObjectsOutput.NextContinuationToken
+		}
+	})
+}
+
+// clearVersions removes every version and delete marker in the bucket,
+// optionally passing mfa through to DeleteObjects for buckets with
+// MFA delete enabled.
+func (s *S3Bucket) clearVersions(ctx context.Context, bucketName, mfa string) error {
+	return s.purge(ctx, bucketName, mfa, func(ctx context.Context, batches chan<- []*s3.ObjectIdentifier) error {
+		var keyMarker, versionIdMarker *string
+
+		for {
+			listVersionsInput := &s3.ListObjectVersionsInput{
+				Bucket:          aws.String(bucketName),
+				KeyMarker:       keyMarker,
+				VersionIdMarker: versionIdMarker,
+			}
+			s.logger.Debug("list-versions", lager.Data{"input": listVersionsInput})
+
+			listVersionsOutput, err := s.s3svc.ListObjectVersions(listVersionsInput)
+			if err != nil {
+				s.logger.Error("aws-s3-error", err)
+				return wrapAWSError(err)
+			}
+
+			objects := make([]*s3.ObjectIdentifier, 0, len(listVersionsOutput.Versions)+len(listVersionsOutput.DeleteMarkers))
+			for _, version := range listVersionsOutput.Versions {
+				objects = append(objects, &s3.ObjectIdentifier{
+					Key:       version.Key,
+					VersionId: version.VersionId,
+				})
+			}
+			for _, marker := range listVersionsOutput.DeleteMarkers {
+				objects = append(objects, &s3.ObjectIdentifier{
+					Key:       marker.Key,
+					VersionId: marker.VersionId,
+				})
+			}
+
+			if len(objects) > 0 {
+				if err := sendBatch(ctx, batches, objects); err != nil {
+					return err
+				}
+			}
+
+			keyMarker = listVersionsOutput.NextKeyMarker
+			versionIdMarker = listVersionsOutput.NextVersionIdMarker
+			if !aws.BoolValue(listVersionsOutput.IsTruncated) {
+				return nil
+			}
+		}
+	})
+}
+
+// sendBatch pushes a batch of keys onto batches, unblocking early if ctx
+// is cancelled by a worker's unrecoverable failure.
+func sendBatch(ctx context.Context, batches chan<- []*s3.ObjectIdentifier, objects []*s3.ObjectIdentifier) error {
+	select {
+	case batches <- objects:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// purge runs produce in its own goroutine to page through S3 and push
+// batches of up to 1000 keys onto a channel, while s.deleteConcurrency
+// workers drain the channel and issue DeleteObjects on each batch in
+// parallel. Per-key failures reported by DeleteObjects are collected into
+// a *DeleteObjectsError; any other error cancels every in-flight
+// goroutine via ctx and is returned directly.
+func (s *S3Bucket) purge(ctx context.Context, bucketName, mfa string, produce func(context.Context, chan<- []*s3.ObjectIdentifier) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []*s3.ObjectIdentifier)
+	produceErrs := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		produceErrs <- produce(ctx, batches)
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		failures []DeleteObjectError
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	wg.Add(s.deleteConcurrency)
+	for i := 0; i < s.deleteConcurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				deleteObjectsInput := &s3.DeleteObjectsInput{
+					Bucket: aws.String(bucketName),
+					Delete: &s3.Delete{Objects: batch},
+				}
+				if mfa != "" {
+					deleteObjectsInput.MFA = aws.String(mfa)
+				}
+				s.logger.Debug("delete-objects", lager.Data{"input": deleteObjectsInput})
+
+				deleteObjectsOutput, err := s.s3svc.DeleteObjectsWithContext(ctx, deleteObjectsInput)
+				if err != nil {
+					s.logger.Error("aws-s3-error", err)
+					fail(wrapAWSError(err))
+					continue
+				}
+
+				if len(deleteObjectsOutput.Errors) > 0 {
+					mu.Lock()
+					for _, objErr := range deleteObjectsOutput.Errors {
+						failures = append(failures, DeleteObjectError{
+							Key:     aws.StringValue(objErr.Key),
+							Code:    aws.StringValue(objErr.Code),
+							Message: aws.StringValue(objErr.Message),
+						})
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// fail keeps the first error, so a context.Canceled caused by a
+	// worker's failure never replaces that failure.
+	if err := <-produceErrs; err != nil {
+		fail(err)
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if len(failures) > 0 {
+		return &DeleteObjectsError{Errors: failures}
+	}
+	return nil
+}
+
+// wrapAWSError flattens an AWS SDK error down to its code and message, the
+// form the broker's callers expect to surface to operators.
+func wrapAWSError(err error) error {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return errors.New(awsErr.Code() + ": " + awsErr.Message())
+	}
+	return err
+}
+
+// isAWSErrCode reports whether err is an awserr.Error with one of the given
+// codes, used to treat "not configured" responses as an empty result rather
+// than a failure.
+func isAWSErrCode(err error, codes ...string) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if awsErr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,90 @@
+package awss3
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeSecureTransportDenyOnEmptyPolicy(t *testing.T) {
+	merged, err := mergeSecureTransportDeny("", "my-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Version   string
+		Statement []map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(merged), &doc); err != nil {
+		t.Fatalf("merged policy is not valid JSON: %v", err)
+	}
+
+	if doc.Version != "2012-10-17" {
+		t.Fatalf("expected a fresh policy to carry the standard version, got %q", doc.Version)
+	}
+	if len(doc.Statement) != 1 {
+		t.Fatalf("expected exactly one statement, got %d", len(doc.Statement))
+	}
+	if sid, _ := doc.Statement[0]["Sid"].(string); sid != denyInsecureTransportSid {
+		t.Fatalf("expected the deny statement's Sid to be %q, got %q", denyInsecureTransportSid, sid)
+	}
+}
+
+func TestMergeSecureTransportDenyPreservesExistingStatements(t *testing.T) {
+	existing := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Sid": "AllowReadOnly", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::my-bucket/*"}
+		]
+	}`
+
+	merged, err := mergeSecureTransportDeny(existing, "my-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Statement []map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(merged), &doc); err != nil {
+		t.Fatalf("merged policy is not valid JSON: %v", err)
+	}
+
+	if len(doc.Statement) != 2 {
+		t.Fatalf("expected the existing statement plus the deny statement, got %d statements", len(doc.Statement))
+	}
+	if sid, _ := doc.Statement[0]["Sid"].(string); sid != "AllowReadOnly" {
+		t.Fatalf("expected the original statement to be preserved untouched, got Sid %q", sid)
+	}
+	if sid, _ := doc.Statement[1]["Sid"].(string); sid != denyInsecureTransportSid {
+		t.Fatalf("expected the deny statement to be appended last, got Sid %q", sid)
+	}
+}
+
+func TestMergeSecureTransportDenyOnInvalidPolicy(t *testing.T) {
+	if _, err := mergeSecureTransportDeny("not json", "my-bucket"); err == nil {
+		t.Fatal("expected an error parsing an invalid existing policy")
+	}
+}
+
+func TestMergeSecureTransportDenyScopesResourceToBucket(t *testing.T) {
+	merged, err := mergeSecureTransportDeny("", "my-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc struct {
+		Statement []struct {
+			Resource []string
+		}
+	}
+	if err := json.Unmarshal([]byte(merged), &doc); err != nil {
+		t.Fatalf("merged policy is not valid JSON: %v", err)
+	}
+
+	want := []string{"arn:aws:s3:::my-bucket", "arn:aws:s3:::my-bucket/*"}
+	got := doc.Statement[0].Resource
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected deny statement to cover the bucket and its objects, got %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-community/s3-broker/awss3"
+)
+
+// BindResponse carries the per-binding IAM credentials returned to the
+// platform when binding an instance that lives under a prefix inside a
+// shared bucket.
+type BindResponse struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+	KeyPrefix       string
+	Region          string
+}
+
+// sharedBindPolicyTemplate scopes s3:GetObject/PutObject/DeleteObject to
+// objects under the binding's prefix, and s3:ListBucket to keys matching
+// that prefix, via the s3:prefix condition key.
+const sharedBindPolicyTemplate = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": ["s3:GetObject", "s3:PutObject", "s3:DeleteObject"],
+      "Resource": "arn:aws:s3:::%[1]s/%[2]s/*"
+    },
+    {
+      "Effect": "Allow",
+      "Action": "s3:ListBucket",
+      "Resource": "arn:aws:s3:::%[1]s",
+      "Condition": {
+        "StringLike": {
+          "s3:prefix": ["%[2]s/*"]
+        }
+      }
+    }
+  ]
+}`
+
+// dedicatedBindPolicyTemplate grants access to every object in the
+// instance's own bucket, since a dedicated bucket has no other binding
+// to scope access away from.
+const dedicatedBindPolicyTemplate = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": ["s3:GetObject", "s3:PutObject", "s3:DeleteObject"],
+      "Resource": "arn:aws:s3:::%[1]s/*"
+    },
+    {
+      "Effect": "Allow",
+      "Action": "s3:ListBucket",
+      "Resource": "arn:aws:s3:::%[1]s"
+    }
+  ]
+}`
+
+func bindingUserName(instanceID, bindingID string) string {
+	return fmt.Sprintf("s3-broker-%s-%s", instanceID, bindingID)
+}
+
+func bindingPolicyName(bindingID string) string {
+	return fmt.Sprintf("s3-broker-binding-%s", bindingID)
+}
+
+// bindPolicy builds the IAM policy document for bucketDetails: scoped to
+// KeyPrefix inside SharedBucket for a shared-bucket instance, or to the
+// whole of BucketName for a dedicated one.
+func bindPolicy(bucketDetails awss3.BucketDetails) string {
+	if bucketDetails.SharedBucket != "" {
+		return fmt.Sprintf(sharedBindPolicyTemplate, bucketDetails.SharedBucket, bucketDetails.KeyPrefix)
+	}
+	return fmt.Sprintf(dedicatedBindPolicyTemplate, bucketDetails.BucketName)
+}
+
+// Bind provisions a dedicated IAM user and access key for the binding,
+// restricted to bucketDetails.KeyPrefix inside bucketDetails.SharedBucket
+// for a shared-bucket instance, or to the whole of bucketDetails.BucketName
+// for a dedicated one.
+func (b *Broker) Bind(instanceID, bindingID string, bucketDetails awss3.BucketDetails) (BindResponse, error) {
+	userName := bindingUserName(instanceID, bindingID)
+
+	if _, err := b.iam.CreateUser(userName); err != nil {
+		return BindResponse{}, err
+	}
+
+	policy := bindPolicy(bucketDetails)
+	if err := b.iam.PutUserPolicy(userName, bindingPolicyName(bindingID), policy); err != nil {
+		b.iam.DeleteUser(userName)
+		return BindResponse{}, err
+	}
+
+	accessKeyID, secretAccessKey, err := b.iam.CreateAccessKey(userName)
+	if err != nil {
+		b.iam.DeleteUserPolicy(userName, bindingPolicyName(bindingID))
+		b.iam.DeleteUser(userName)
+		return BindResponse{}, err
+	}
+
+	bucket := bucketDetails.SharedBucket
+	if bucket == "" {
+		bucket = bucketDetails.BucketName
+	}
+
+	return BindResponse{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		Bucket:          bucket,
+		KeyPrefix:       bucketDetails.KeyPrefix,
+		Region:          bucketDetails.Region,
+	}, nil
+}
+
+// Unbind removes the IAM user and access key created by Bind.
+func (b *Broker) Unbind(instanceID, bindingID string) error {
+	userName := bindingUserName(instanceID, bindingID)
+
+	if err := b.iam.DeleteUserPolicy(userName, bindingPolicyName(bindingID)); err != nil {
+		return err
+	}
+	if err := b.iam.DeleteAccessKeys(userName); err != nil {
+		return err
+	}
+	return b.iam.DeleteUser(userName)
+}
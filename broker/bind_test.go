@@ -0,0 +1,141 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-community/s3-broker/awss3"
+)
+
+type fakeIAM struct {
+	createUserErr      error
+	putUserPolicyErr   error
+	createAccessKeyErr error
+
+	putUserPolicyUserName string
+	putUserPolicyDocument string
+
+	deleteUserCalls       int
+	deleteUserPolicyCalls int
+	deleteAccessKeyCalls  int
+}
+
+func (f *fakeIAM) CreateUser(userName string) (string, error) {
+	return "arn:aws:iam::111111111111:user/" + userName, f.createUserErr
+}
+
+func (f *fakeIAM) DeleteUser(userName string) error {
+	f.deleteUserCalls++
+	return nil
+}
+
+func (f *fakeIAM) PutUserPolicy(userName, policyName, policyDocument string) error {
+	f.putUserPolicyUserName = userName
+	f.putUserPolicyDocument = policyDocument
+	return f.putUserPolicyErr
+}
+
+func (f *fakeIAM) DeleteUserPolicy(userName, policyName string) error {
+	f.deleteUserPolicyCalls++
+	return nil
+}
+
+func (f *fakeIAM) CreateAccessKey(userName string) (string, string, error) {
+	if f.createAccessKeyErr != nil {
+		return "", "", f.createAccessKeyErr
+	}
+	return "AKIAEXAMPLE", "secret", nil
+}
+
+func (f *fakeIAM) DeleteAccessKeys(userName string) error {
+	f.deleteAccessKeyCalls++
+	return nil
+}
+
+func newTestBroker(iam *fakeIAM) *Broker {
+	return New(nil, iam, Config{}, lager.NewLogger("test"))
+}
+
+func TestBindScopesPolicyToSharedBucketPrefix(t *testing.T) {
+	iam := &fakeIAM{}
+	b := newTestBroker(iam)
+
+	resp, err := b.Bind("instance-1", "binding-1", awss3.BucketDetails{
+		SharedBucket: "shared-bucket",
+		KeyPrefix:    "instance-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Bucket != "shared-bucket" {
+		t.Fatalf("expected the response to carry the shared bucket, got %q", resp.Bucket)
+	}
+	if !strings.Contains(iam.putUserPolicyDocument, `arn:aws:s3:::shared-bucket/instance-1/*`) {
+		t.Fatalf("expected the policy to scope access to the shared bucket's prefix, got %s", iam.putUserPolicyDocument)
+	}
+}
+
+func TestBindScopesPolicyToDedicatedBucket(t *testing.T) {
+	iam := &fakeIAM{}
+	b := newTestBroker(iam)
+
+	resp, err := b.Bind("instance-1", "binding-1", awss3.BucketDetails{
+		BucketName: "dedicated-bucket",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Bucket != "dedicated-bucket" {
+		t.Fatalf("expected the response to carry the instance's own bucket, got %q", resp.Bucket)
+	}
+	if !strings.Contains(iam.putUserPolicyDocument, `arn:aws:s3:::dedicated-bucket/*`) {
+		t.Fatalf("expected the policy to scope access to the whole dedicated bucket, got %s", iam.putUserPolicyDocument)
+	}
+	if strings.Contains(iam.putUserPolicyDocument, `arn:aws:s3:::/`) {
+		t.Fatalf("expected no policy scoped to an empty SharedBucket, got %s", iam.putUserPolicyDocument)
+	}
+}
+
+func TestBindRollsBackUserOnPutUserPolicyError(t *testing.T) {
+	iam := &fakeIAM{putUserPolicyErr: errors.New("boom")}
+	b := newTestBroker(iam)
+
+	_, err := b.Bind("instance-1", "binding-1", awss3.BucketDetails{BucketName: "dedicated-bucket"})
+	if err == nil {
+		t.Fatal("expected the PutUserPolicy error to be returned")
+	}
+	if iam.deleteUserCalls != 1 {
+		t.Fatalf("expected the created user to be rolled back, got %d DeleteUser calls", iam.deleteUserCalls)
+	}
+}
+
+func TestBindRollsBackUserAndPolicyOnCreateAccessKeyError(t *testing.T) {
+	iam := &fakeIAM{createAccessKeyErr: errors.New("boom")}
+	b := newTestBroker(iam)
+
+	_, err := b.Bind("instance-1", "binding-1", awss3.BucketDetails{BucketName: "dedicated-bucket"})
+	if err == nil {
+		t.Fatal("expected the CreateAccessKey error to be returned")
+	}
+	if iam.deleteUserPolicyCalls != 1 || iam.deleteUserCalls != 1 {
+		t.Fatalf("expected both the policy and the user to be rolled back, got %d policy / %d user deletes",
+			iam.deleteUserPolicyCalls, iam.deleteUserCalls)
+	}
+}
+
+func TestUnbindDeletesPolicyKeysAndUser(t *testing.T) {
+	iam := &fakeIAM{}
+	b := newTestBroker(iam)
+
+	if err := b.Unbind("instance-1", "binding-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if iam.deleteUserPolicyCalls != 1 || iam.deleteAccessKeyCalls != 1 || iam.deleteUserCalls != 1 {
+		t.Fatalf("expected Unbind to delete the policy, keys, and user exactly once each, got %+v", iam)
+	}
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-community/s3-broker/awsiam"
+	"github.com/cloudfoundry-community/s3-broker/awss3"
+)
+
+// Broker provisions and binds S3 buckets on behalf of the platform,
+// combining the AWS S3 and IAM clients with the operator's configuration.
+type Broker struct {
+	bucket awss3.Bucket
+	iam    awsiam.IAM
+	config Config
+	logger lager.Logger
+}
+
+func New(
+	bucket awss3.Bucket,
+	iam awsiam.IAM,
+	config Config,
+	logger lager.Logger,
+) *Broker {
+	return &Broker{
+		bucket: bucket,
+		iam:    iam,
+		config: config,
+		logger: logger.Session("broker"),
+	}
+}
+
+// Provision creates bucketName's backing storage. Instances that share a
+// bucket (BucketDetails.SharedBucket is set) have no storage to create:
+// their prefix comes into existence the first time an object is written
+// under it.
+func (b *Broker) Provision(ctx context.Context, bucketName string, bucketDetails awss3.BucketDetails) (string, error) {
+	if bucketDetails.SharedBucket != "" {
+		return bucketDetails.SharedBucket, nil
+	}
+
+	return b.bucket.Create(ctx, bucketName, bucketDetails)
+}
+
+// Deprovision removes bucketName's backing storage. Instances that share
+// a bucket only have their own prefix removed, never the shared bucket
+// itself: DeletePolicyEmptyOnly removes the prefix's current-version
+// objects, DeletePolicyPurge also removes noncurrent versions and delete
+// markers under the prefix, and DeletePolicyRetain (or the zero value)
+// leaves the prefix untouched.
+func (b *Broker) Deprovision(ctx context.Context, bucketName string, bucketDetails awss3.BucketDetails) error {
+	if bucketDetails.SharedBucket != "" {
+		switch bucketDetails.DeletePolicy {
+		case awss3.DeletePolicyPurge:
+			return b.bucket.DeletePrefix(ctx, bucketDetails.SharedBucket, bucketDetails.KeyPrefix, true, bucketDetails.MFA)
+		case awss3.DeletePolicyEmptyOnly:
+			return b.bucket.DeletePrefix(ctx, bucketDetails.SharedBucket, bucketDetails.KeyPrefix, false, "")
+		default:
+			return nil
+		}
+	}
+
+	return b.bucket.Delete(ctx, bucketName, bucketDetails)
+}
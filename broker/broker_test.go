@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-community/s3-broker/awss3"
+)
+
+type fakeBucket struct {
+	createErr error
+	deleteErr error
+
+	deletePrefixCalls  int
+	deletePrefixBucket string
+	deletePrefixPrefix string
+	deletePrefixPurge  bool
+	deletePrefixMFA    string
+
+	deleteCalls int
+}
+
+func (f *fakeBucket) Describe(ctx context.Context, bucketName, partition string) (awss3.BucketDetails, error) {
+	return awss3.BucketDetails{}, nil
+}
+
+func (f *fakeBucket) Create(ctx context.Context, bucketName string, details awss3.BucketDetails) (string, error) {
+	return bucketName, f.createErr
+}
+
+func (f *fakeBucket) Modify(ctx context.Context, bucketName string, details awss3.BucketDetails) error {
+	return nil
+}
+
+func (f *fakeBucket) Delete(ctx context.Context, bucketName string, details awss3.BucketDetails) error {
+	f.deleteCalls++
+	return f.deleteErr
+}
+
+func (f *fakeBucket) DeletePrefix(ctx context.Context, bucketName, prefix string, purgeVersions bool, mfa string) error {
+	f.deletePrefixCalls++
+	f.deletePrefixBucket = bucketName
+	f.deletePrefixPrefix = prefix
+	f.deletePrefixPurge = purgeVersions
+	f.deletePrefixMFA = mfa
+	return nil
+}
+
+func TestDeprovisionPurgePolicyPurgesVersionsUnderPrefix(t *testing.T) {
+	bucket := &fakeBucket{}
+	b := New(bucket, nil, Config{}, lager.NewLogger("test"))
+
+	bucketDetails := awss3.BucketDetails{
+		SharedBucket: "shared-bucket",
+		KeyPrefix:    "instance-1",
+		DeletePolicy: awss3.DeletePolicyPurge,
+		MFA:          "device 123456",
+	}
+	if err := b.Deprovision(context.Background(), "instance-1", bucketDetails); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bucket.deletePrefixCalls != 1 {
+		t.Fatalf("expected DeletePrefix to be called once, got %d", bucket.deletePrefixCalls)
+	}
+	if !bucket.deletePrefixPurge {
+		t.Fatal("expected DeletePolicyPurge to request a version purge")
+	}
+	if bucket.deletePrefixBucket != "shared-bucket" || bucket.deletePrefixPrefix != "instance-1" {
+		t.Fatalf("expected DeletePrefix to target the shared bucket's prefix, got bucket=%q prefix=%q",
+			bucket.deletePrefixBucket, bucket.deletePrefixPrefix)
+	}
+	if bucket.deletePrefixMFA != "device 123456" {
+		t.Fatalf("expected the MFA code to reach DeletePrefix, got %q", bucket.deletePrefixMFA)
+	}
+	if bucket.deleteCalls != 0 {
+		t.Fatal("expected a shared-bucket instance to never delete the shared bucket itself")
+	}
+}
+
+func TestDeprovisionEmptyOnlyPolicyDoesNotPurgeVersions(t *testing.T) {
+	bucket := &fakeBucket{}
+	b := New(bucket, nil, Config{}, lager.NewLogger("test"))
+
+	bucketDetails := awss3.BucketDetails{
+		SharedBucket: "shared-bucket",
+		KeyPrefix:    "instance-1",
+		DeletePolicy: awss3.DeletePolicyEmptyOnly,
+	}
+	if err := b.Deprovision(context.Background(), "instance-1", bucketDetails); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bucket.deletePrefixCalls != 1 {
+		t.Fatalf("expected DeletePrefix to be called once, got %d", bucket.deletePrefixCalls)
+	}
+	if bucket.deletePrefixPurge {
+		t.Fatal("expected DeletePolicyEmptyOnly to leave noncurrent versions alone")
+	}
+}
+
+func TestDeprovisionRetainPolicyLeavesSharedPrefixUntouched(t *testing.T) {
+	bucket := &fakeBucket{}
+	b := New(bucket, nil, Config{}, lager.NewLogger("test"))
+
+	bucketDetails := awss3.BucketDetails{
+		SharedBucket: "shared-bucket",
+		KeyPrefix:    "instance-1",
+		DeletePolicy: awss3.DeletePolicyRetain,
+	}
+	if err := b.Deprovision(context.Background(), "instance-1", bucketDetails); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bucket.deletePrefixCalls != 0 {
+		t.Fatalf("expected DeletePolicyRetain to leave the prefix untouched, got %d DeletePrefix calls", bucket.deletePrefixCalls)
+	}
+}
+
+func TestDeprovisionDedicatedBucketDeletesTheBucketItself(t *testing.T) {
+	bucket := &fakeBucket{}
+	b := New(bucket, nil, Config{}, lager.NewLogger("test"))
+
+	if err := b.Deprovision(context.Background(), "instance-1", awss3.BucketDetails{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bucket.deleteCalls != 1 {
+		t.Fatalf("expected a dedicated instance to delete its own bucket, got %d Delete calls", bucket.deleteCalls)
+	}
+	if bucket.deletePrefixCalls != 0 {
+		t.Fatal("expected a dedicated instance to never call DeletePrefix")
+	}
+}
+
+func TestProvisionSharedBucketInstanceCreatesNoStorage(t *testing.T) {
+	bucket := &fakeBucket{createErr: errors.New("Create should not be called")}
+	b := New(bucket, nil, Config{}, lager.NewLogger("test"))
+
+	got, err := b.Provision(context.Background(), "instance-1", awss3.BucketDetails{SharedBucket: "shared-bucket"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "shared-bucket" {
+		t.Fatalf("expected Provision to report the shared bucket, got %q", got)
+	}
+}
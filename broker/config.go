@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-community/s3-broker/awss3"
+)
+
+// Config holds broker-wide settings, loaded from the operator's
+// configuration file, that apply across every provisioned instance.
+type Config struct {
+	// SharedBucket names a pre-created bucket for instances that live
+	// under a key prefix rather than in a bucket of their own. Broker
+	// does not read this field: Provision, Bind and Deprovision take the
+	// shared bucket from BucketDetails.SharedBucket.
+	SharedBucket string `json:"shared_bucket"`
+
+	// Retry controls how aggressively S3Bucket retries transient AWS
+	// errors. Any zero-valued field falls back to awss3.DefaultRetryConfig.
+	Retry RetryConfig `json:"retry"`
+
+	// DeleteConcurrency is the number of workers S3Bucket uses to purge
+	// a bucket's objects and versions in parallel during deprovisioning.
+	// Defaults to awss3.DefaultDeleteConcurrency.
+	DeleteConcurrency int `json:"delete_concurrency"`
+
+	// SecureDefaults is the hardening applied to every bucket on
+	// provisioning, unless a plan opts an instance out.
+	SecureDefaults SecureDefaults `json:"secure_defaults"`
+}
+
+// SecureDefaults is the JSON-friendly mirror of awss3.SecureDefaultsConfig.
+type SecureDefaults struct {
+	Enabled         bool   `json:"enabled"`
+	KMSMasterKeyID  string `json:"kms_master_key_id"`
+	ObjectOwnership string `json:"object_ownership"`
+}
+
+// RetryConfig is the JSON-friendly mirror of awss3.RetryConfig.
+type RetryConfig struct {
+	MaxAttempts int           `json:"max_attempts"`
+	MaxElapsed  time.Duration `json:"max_elapsed"`
+	BaseDelay   time.Duration `json:"base_delay"`
+}
+
+// AWSRetryConfig converts Retry into an awss3.RetryConfig, substituting
+// awss3.DefaultRetryConfig's values for any field left at its zero value.
+func (c Config) AWSRetryConfig() awss3.RetryConfig {
+	config := awss3.DefaultRetryConfig
+	if c.Retry.MaxAttempts != 0 {
+		config.MaxAttempts = c.Retry.MaxAttempts
+	}
+	if c.Retry.MaxElapsed != 0 {
+		config.MaxElapsed = c.Retry.MaxElapsed
+	}
+	if c.Retry.BaseDelay != 0 {
+		config.BaseDelay = c.Retry.BaseDelay
+	}
+	return config
+}
+
+// AWSDeleteConcurrency returns DeleteConcurrency, or
+// awss3.DefaultDeleteConcurrency if it was left unset.
+func (c Config) AWSDeleteConcurrency() int {
+	if c.DeleteConcurrency > 0 {
+		return c.DeleteConcurrency
+	}
+	return awss3.DefaultDeleteConcurrency
+}
+
+// AWSSecureDefaultsConfig converts SecureDefaults into an
+// awss3.SecureDefaultsConfig.
+func (c Config) AWSSecureDefaultsConfig() awss3.SecureDefaultsConfig {
+	return awss3.SecureDefaultsConfig{
+		Enabled:         c.SecureDefaults.Enabled,
+		KMSMasterKeyID:  c.SecureDefaults.KMSMasterKeyID,
+		ObjectOwnership: c.SecureDefaults.ObjectOwnership,
+	}
+}
+
+func (c Config) Validate() error {
+	return nil
+}